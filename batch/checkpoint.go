@@ -0,0 +1,179 @@
+package batch
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default cadence for flushing the checkpoint file to disk.
+const (
+	DefaultCheckpointEveryRows = 100
+	DefaultCheckpointInterval  = 5 * time.Second
+)
+
+// Checkpoint tracks which input rows have completed processing and
+// periodically persists the highest row number completed contiguously from
+// row 1 (the "watermark") to its file, so a later run can resume after it
+// instead of reprocessing rows or losing track of rows that were still
+// in-flight when the job was interrupted.
+//
+// Rows can complete out of order, since RunWithCodec fans requests out
+// across goroutines bounded by a semaphore. Checkpoint buffers the
+// out-of-order completions in a min-heap and only advances the watermark as
+// the next expected row arrives.
+//
+// Checkpoint is thread-safe.
+type Checkpoint struct {
+	mu        sync.Mutex
+	file      *os.File
+	everyRows int
+	everyDur  time.Duration
+
+	watermark      int
+	rowsSinceFlush int
+	pending        rowHeap
+	lastFlush      time.Time
+	dirty          bool
+}
+
+// NewCheckpoint opens (or creates) the checkpoint file at path for
+// appending and returns a Checkpoint that flushes the watermark to it every
+// everyRows newly completed rows or everyDur, whichever comes first. Zero
+// values use DefaultCheckpointEveryRows/DefaultCheckpointInterval.
+func NewCheckpoint(path string, everyRows int, everyDur time.Duration) (*Checkpoint, error) {
+	if everyRows <= 0 {
+		everyRows = DefaultCheckpointEveryRows
+	}
+	if everyDur <= 0 {
+		everyDur = DefaultCheckpointInterval
+	}
+	f, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{
+		file:      f,
+		everyRows: everyRows,
+		everyDur:  everyDur,
+		lastFlush: time.Now(),
+	}, nil
+}
+
+// ReadCheckpoint reads the last watermark recorded in the checkpoint file at
+// path, returning 0 if the file does not exist or has never been flushed.
+func ReadCheckpoint(path string) (int, error) {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	last := lines[len(lines)-1]
+	if last == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(last)
+}
+
+// SeedWatermark initializes the watermark to seed, e.g. the row a resumed
+// run was told to skip past, so that Complete's contiguous-run detection
+// resumes from there instead of from 0. It must be called before any call
+// to Complete and is a no-op if seed is not greater than the current
+// watermark.
+func (c *Checkpoint) SeedWatermark(seed int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if seed > c.watermark {
+		c.watermark = seed
+	}
+}
+
+// Complete records that row finished processing, successfully or not, and
+// advances the watermark past any now-contiguous run of completed rows,
+// flushing to disk if the configured cadence was reached.
+func (c *Checkpoint) Complete(row int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	heap.Push(&c.pending, row)
+	for len(c.pending) > 0 && c.pending[0] == c.watermark+1 {
+		heap.Pop(&c.pending)
+		c.watermark++
+		c.rowsSinceFlush++
+		c.dirty = true
+	}
+
+	if c.dirty && (c.rowsSinceFlush >= c.everyRows || time.Since(c.lastFlush) >= c.everyDur) {
+		return c.flushLocked()
+	}
+	return nil
+}
+
+// Flush persists the current watermark to disk regardless of cadence.
+func (c *Checkpoint) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushLocked()
+}
+
+func (c *Checkpoint) flushLocked() error {
+	if !c.dirty {
+		return nil
+	}
+	if _, err := fmt.Fprintf(c.file, "%d\n", c.watermark); err != nil {
+		return err
+	}
+	if err := c.file.Sync(); err != nil {
+		return err
+	}
+	c.dirty = false
+	c.rowsSinceFlush = 0
+	c.lastFlush = time.Now()
+	return nil
+}
+
+// Close flushes any unwritten watermark and closes the checkpoint file.
+func (c *Checkpoint) Close() error {
+	flushErr := c.Flush()
+	closeErr := c.file.Close()
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+// Watermark returns the highest row number completed contiguously from row
+// 1, i.e. the row a resumed run should continue after.
+func (c *Checkpoint) Watermark() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.watermark
+}
+
+// rowHeap is a min-heap of pending, out-of-order completed row numbers,
+// used by Checkpoint to detect when the watermark can advance.
+type rowHeap []int
+
+func (h rowHeap) Len() int           { return len(h) }
+func (h rowHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h rowHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *rowHeap) Push(x any) {
+	*h = append(*h, x.(int))
+}
+
+func (h *rowHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,89 @@
+package batch
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointAdvancesWatermarkOutOfOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	cp, err := NewCheckpoint(path, 1, time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewCheckpoint: %v", err)
+	}
+
+	for _, row := range []int{2, 1, 3} {
+		if err := cp.Complete(row); err != nil {
+			t.Fatalf("Complete(%d): %v", row, err)
+		}
+	}
+	if got := cp.Watermark(); got != 3 {
+		t.Fatalf("Watermark() = %d, want 3", got)
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	watermark, err := ReadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint: %v", err)
+	}
+	if watermark != 3 {
+		t.Fatalf("ReadCheckpoint() = %d, want 3", watermark)
+	}
+}
+
+// TestCheckpointResumeSeedsWatermark reproduces a crash-and-resume cycle: a
+// first run completes rows 1-5, a resumed run skips to row 6 and completes
+// rows 6-10, and the persisted watermark must reflect row 10, not stay
+// stuck at 5 because the resumed Checkpoint started from a watermark of 0.
+func TestCheckpointResumeSeedsWatermark(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+
+	first, err := NewCheckpoint(path, 1, time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewCheckpoint: %v", err)
+	}
+	for row := 1; row <= 5; row++ {
+		if err := first.Complete(row); err != nil {
+			t.Fatalf("Complete(%d): %v", row, err)
+		}
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	skip, err := ReadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint: %v", err)
+	}
+	if skip != 5 {
+		t.Fatalf("ReadCheckpoint() = %d, want 5", skip)
+	}
+
+	resumed, err := NewCheckpoint(path, 1, time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewCheckpoint: %v", err)
+	}
+	resumed.SeedWatermark(skip)
+	for row := 6; row <= 10; row++ {
+		if err := resumed.Complete(row); err != nil {
+			t.Fatalf("Complete(%d): %v", row, err)
+		}
+	}
+	if got := resumed.Watermark(); got != 10 {
+		t.Fatalf("Watermark() = %d, want 10", got)
+	}
+	if err := resumed.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	watermark, err := ReadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint: %v", err)
+	}
+	if watermark != 10 {
+		t.Fatalf("ReadCheckpoint() after resume = %d, want 10", watermark)
+	}
+}
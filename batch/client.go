@@ -3,18 +3,41 @@ package batch
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/textproto"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Default retry settings applied whenever the corresponding Config field is
+// left at its zero value.
+const (
+	DefaultRetryMaxAttempts = 5
+	DefaultRetryBaseDelay   = 200 * time.Millisecond
+	DefaultRetryMaxDelay    = 30 * time.Second
 )
 
+// minRateLimit is the floor the rate limiter's AIMD backoff will not go
+// below, so a run of 429s never drives the effective rate to zero.
+const minRateLimit rate.Limit = 0.01
+
+// rateRecoverStep is the fraction of the configured rate that is restored
+// towards RequestsPerSecond after each response that is not a 429.
+const rateRecoverStep = 0.05
+
 // Client is used for making GraphQL requests via HTTP using pre-configured
 // url, query, header and login information.
 //
@@ -27,15 +50,35 @@ type Client struct {
 	header     http.Header
 	oauth      *OAuthConfig
 	token      *string
+	stats      Stats
+	logger     Logger
+
+	retryMaxAttempts int
+	retryBaseDelay   time.Duration
+	retryMaxDelay    time.Duration
+	retryOnStatuses  map[int]bool
+
+	limiter  *rate.Limiter
+	baseRate float64
 }
 
 // NewClient creates a new Client using the provided configuration and query.
-func NewClient(config Config, query string) (*Client, error) {
+//
+// stats is used to record retries as they happen; pass &SilentStats{} if
+// retry counts are not of interest. logger is used to report retries as
+// structured log events.
+func NewClient(config Config, query string, stats Stats, logger Logger) (*Client, error) {
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	transport.MaxConnsPerHost = config.Connections
 	transport.MaxIdleConns = config.Connections
 	transport.MaxIdleConnsPerHost = config.Connections
 
+	if config.UnixSocket != "" {
+		if err := dialUnixSocket(transport, config.UnixSocket, config.URL, config.TLSServerName); err != nil {
+			return nil, err
+		}
+	}
+
 	header := http.Header{}
 	if len(config.Headers) != 0 {
 		hs := strings.Join(config.Headers, "\r\n") + "\r\n\r\n"
@@ -47,6 +90,19 @@ func NewClient(config Config, query string) (*Client, error) {
 		header = http.Header(mimeHeader)
 	}
 
+	retryMaxAttempts := config.RetryMaxAttempts
+	if retryMaxAttempts == 0 {
+		retryMaxAttempts = DefaultRetryMaxAttempts
+	}
+	retryBaseDelay := config.RetryBaseDelay
+	if retryBaseDelay == 0 {
+		retryBaseDelay = DefaultRetryBaseDelay
+	}
+	retryMaxDelay := config.RetryMaxDelay
+	if retryMaxDelay == 0 {
+		retryMaxDelay = DefaultRetryMaxDelay
+	}
+
 	client := &Client{
 		httpClient: &http.Client{
 			Transport: transport,
@@ -54,6 +110,13 @@ func NewClient(config Config, query string) (*Client, error) {
 		query:  query,
 		url:    config.URL,
 		header: header,
+		stats:  stats,
+		logger: logger,
+
+		retryMaxAttempts: retryMaxAttempts,
+		retryBaseDelay:   retryBaseDelay,
+		retryMaxDelay:    retryMaxDelay,
+		retryOnStatuses:  toStatusSet(config.RetryOnStatuses),
 	}
 	if config.OAuth.URL != "" {
 		client.oauth = &config.OAuth
@@ -61,10 +124,69 @@ func NewClient(config Config, query string) (*Client, error) {
 	if config.BearerToken != "" {
 		client.token = &config.BearerToken
 	}
+	if config.RequestsPerSecond > 0 {
+		burst := config.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		client.baseRate = config.RequestsPerSecond
+		client.limiter = rate.NewLimiter(rate.Limit(config.RequestsPerSecond), burst)
+	}
 
 	return client, nil
 }
 
+// dialUnixSocket reconfigures transport to dial sockPath, a Unix domain
+// socket, instead of making a TCP connection, so GraphQL endpoints exposed
+// only over a UDS (sidecars, local dev, sandboxed deployments) can be
+// reached without a TCP listener. requestURL's scheme selects the behavior:
+// for "https" the connection is upgraded to TLS on top of the unix dialer,
+// validating the server certificate against tlsServerName (or, if empty,
+// requestURL's host); any other scheme dials the socket in plain text.
+func dialUnixSocket(transport *http.Transport, sockPath, requestURL, tlsServerName string) error {
+	dialUnix := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", sockPath)
+	}
+
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(u.Scheme, "https") {
+		transport.DialContext = dialUnix
+		return nil
+	}
+
+	serverName := tlsServerName
+	if serverName == "" {
+		serverName = u.Hostname()
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		rawConn, err := dialUnix(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(rawConn, &tls.Config{ServerName: serverName})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = rawConn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return nil
+}
+
+func toStatusSet(statuses []int) map[int]bool {
+	if len(statuses) == 0 {
+		return nil
+	}
+	set := make(map[int]bool, len(statuses))
+	for _, s := range statuses {
+		set[s] = true
+	}
+	return set
+}
+
 // Do sends the GraphQL request using the configured query and the provided
 // variables.
 //
@@ -72,16 +194,27 @@ func NewClient(config Config, query string) (*Client, error) {
 // For unsuccessful requests it will return an error and if possible the
 // response body.
 //
+// Connection errors, 408, 429 and 5xx responses are retried with capped
+// exponential backoff and full jitter, honoring a Retry-After header when
+// the server sends one. Retries stop once ctx is cancelled or the
+// configured retry budget is exhausted; 4xx statuses other than 408 and 429
+// are never retried. If a rate limit was configured, it is applied before
+// every attempt and backed off (AIMD) whenever the server answers with 429.
+//
 // If the client was configured with OAuth credentials, it will follow a
 // client_credentials flow to receive a valid authorization token. The token
 // will automatically be renewed before its expiry.
 //
 // For any authorization other flow you can provide the required authorization
 // headers during client creation.
-func (c *Client) Do(variables map[string]any) (io.ReadCloser, error) {
-	token, err := c.ensureValidToken()
+//
+// The returned status code is the HTTP status of the final attempt, or 0 if
+// the final attempt received no response (e.g. a connection error) or ctx
+// was cancelled while waiting to retry, even if earlier attempts did.
+func (c *Client) Do(ctx context.Context, variables map[string]any) (io.ReadCloser, int, error) {
+	token, err := c.ensureValidToken(ctx)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	requestBody, err := json.Marshal(requestParameters{
@@ -89,37 +222,155 @@ func (c *Client) Do(variables map[string]any) (io.ReadCloser, error) {
 		Variables: variables,
 	})
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	request, err := http.NewRequest("POST", c.url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, err
-	}
-	for hk, hv := range c.header {
-		for _, v := range hv {
-			request.Header.Add(hk, v)
+	var lastResp *http.Response
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if err := c.backoff(ctx, attempt, lastResp); err != nil {
+				if lastResp != nil {
+					_ = lastResp.Body.Close()
+				}
+				return nil, 0, err
+			}
+			c.stats.AddRetry()
+			statusCode := 0
+			if lastResp != nil {
+				statusCode = lastResp.StatusCode
+			}
+			c.logger.Warn("request.retry", "attempt", attempt, "status_code", statusCode)
+		}
+		if lastResp != nil {
+			_, _ = io.Copy(io.Discard, lastResp.Body)
+			_ = lastResp.Body.Close()
+			lastResp = nil
+		}
+
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				return nil, 0, err
+			}
 		}
+
+		request, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(requestBody))
+		if err != nil {
+			return nil, 0, err
+		}
+		for hk, hv := range c.header {
+			for _, v := range hv {
+				request.Header.Add(hk, v)
+			}
+		}
+		request.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+		}
+
+		response, err := c.httpClient.Do(request)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= c.retryMaxAttempts {
+				return nil, 0, err
+			}
+			continue
+		}
+		lastResp = response
+
+		if response.StatusCode < 200 || response.StatusCode >= 300 {
+			c.afterResponse(response.StatusCode)
+			if attempt >= c.retryMaxAttempts || !c.isRetryableStatus(response.StatusCode) {
+				return response.Body, response.StatusCode, fmt.Errorf("invalid status code %v", response.StatusCode)
+			}
+			continue
+		}
+
+		c.afterResponse(response.StatusCode)
+		return response.Body, response.StatusCode, nil
 	}
+}
 
-	request.Header.Set("Content-Type", "application/json")
-	if token != "" {
-		request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+// isRetryableStatus reports whether status should trigger a retry. When
+// RetryOnStatuses was configured explicitly, only those codes are retried;
+// otherwise 408, 429 and any 5xx are considered transient.
+func (c *Client) isRetryableStatus(status int) bool {
+	if c.retryOnStatuses != nil {
+		return c.retryOnStatuses[status]
 	}
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
 
-	response, err := c.httpClient.Do(request)
-	if err != nil {
-		return nil, err
+// backoff sleeps before the next retry attempt, honoring a Retry-After
+// header on lastResp if present, and otherwise using capped exponential
+// backoff with full jitter.
+func (c *Client) backoff(ctx context.Context, attempt int, lastResp *http.Response) error {
+	delay := c.backoffDelay(attempt)
+	if lastResp != nil {
+		if d := retryAfterDelay(lastResp.Header.Get("Retry-After")); d > 0 {
+			delay = d
+		}
 	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
 
-	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		return response.Body, fmt.Errorf("invalid status code %v", response.StatusCode)
+func (c *Client) backoffDelay(attempt int) time.Duration {
+	maxDelay := float64(c.retryMaxDelay)
+	delay := float64(c.retryBaseDelay) * math.Pow(2, float64(attempt-1))
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay <= 0 {
+		return 0
 	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// retryAfterDelay parses a Retry-After header, which may be either a number
+// of seconds or an HTTP date, returning 0 if it is absent or invalid.
+func retryAfterDelay(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
 
-	return response.Body, nil
+// afterResponse applies AIMD to the rate limiter: a 429 halves the
+// effective rate, while any other response linearly recovers it back
+// towards the configured RequestsPerSecond.
+func (c *Client) afterResponse(status int) {
+	if c.limiter == nil {
+		return
+	}
+	if status == http.StatusTooManyRequests {
+		next := c.limiter.Limit() / 2
+		if next < minRateLimit {
+			next = minRateLimit
+		}
+		c.limiter.SetLimit(next)
+		return
+	}
+	cur := float64(c.limiter.Limit())
+	if cur >= c.baseRate {
+		return
+	}
+	next := cur + c.baseRate*rateRecoverStep
+	if next > c.baseRate {
+		next = c.baseRate
+	}
+	c.limiter.SetLimit(rate.Limit(next))
 }
 
-func (c *Client) ensureValidToken() (string, error) {
+func (c *Client) ensureValidToken(ctx context.Context) (string, error) {
 	if c.oauth == nil {
 		if c.token == nil {
 			return "", nil
@@ -142,7 +393,7 @@ func (c *Client) ensureValidToken() (string, error) {
 	if c.token != nil {
 		return *c.token, nil
 	}
-	token, err := c.login()
+	token, err := c.login(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -150,43 +401,77 @@ func (c *Client) ensureValidToken() (string, error) {
 	return token, nil
 }
 
-func (c *Client) login() (string, error) {
+func (c *Client) login(ctx context.Context) (string, error) {
 	data := url.Values{
 		"grant_type": {"client_credentials"},
 		"scope":      {c.oauth.Scope},
 	}
-	request, err := http.NewRequest("POST", c.oauth.URL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", err
-	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	request.SetBasicAuth(c.oauth.ClientID, c.oauth.ClientSecret)
-	response, err := c.httpClient.Do(request)
-	if err != nil {
-		return "", err
-	}
-	if response.StatusCode != 200 {
-		return "", fmt.Errorf("invalid status code %v during login", response.StatusCode)
-	}
-	resp := &struct {
-		AccessToken string `json:"access_token"`
-		ExpiresIn   int    `json:"expires_in"`
-	}{}
-	err = json.NewDecoder(response.Body).Decode(resp)
-	if err != nil {
-		return "", err
-	}
-	if resp.AccessToken == "" {
-		return "", fmt.Errorf("login response did not include access token")
+
+	var lastResp *http.Response
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if err := c.backoff(ctx, attempt, lastResp); err != nil {
+				if lastResp != nil {
+					_ = lastResp.Body.Close()
+				}
+				return "", err
+			}
+			c.stats.AddRetry()
+			statusCode := 0
+			if lastResp != nil {
+				statusCode = lastResp.StatusCode
+			}
+			c.logger.Warn("login.retry", "attempt", attempt, "status_code", statusCode)
+		}
+		if lastResp != nil {
+			_, _ = io.Copy(io.Discard, lastResp.Body)
+			_ = lastResp.Body.Close()
+			lastResp = nil
+		}
+
+		request, err := http.NewRequestWithContext(ctx, "POST", c.oauth.URL, strings.NewReader(data.Encode()))
+		if err != nil {
+			return "", err
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth(c.oauth.ClientID, c.oauth.ClientSecret)
+
+		response, err := c.httpClient.Do(request)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= c.retryMaxAttempts {
+				return "", err
+			}
+			continue
+		}
+		lastResp = response
+
+		if response.StatusCode != 200 {
+			if attempt >= c.retryMaxAttempts || !c.isRetryableStatus(response.StatusCode) {
+				return "", fmt.Errorf("invalid status code %v during login", response.StatusCode)
+			}
+			continue
+		}
+
+		resp := &struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}{}
+		err = json.NewDecoder(response.Body).Decode(resp)
+		if err != nil {
+			return "", err
+		}
+		if resp.AccessToken == "" {
+			return "", fmt.Errorf("login response did not include access token")
+		}
+		// ensure that token is removed before it expires
+		expiresIn90p := time.Duration(math.Floor(float64(resp.ExpiresIn)*0.9)) * time.Second
+		time.AfterFunc(expiresIn90p, func() {
+			c.mu.Lock()
+			c.token = nil
+			c.mu.Unlock()
+		})
+		return resp.AccessToken, nil
 	}
-	// ensure that token is removed before it expires
-	expiresIn90p := time.Duration(math.Floor(float64(resp.ExpiresIn)*0.9)) * time.Second
-	time.AfterFunc(expiresIn90p, func() {
-		c.mu.Lock()
-		c.token = nil
-		c.mu.Unlock()
-	})
-	return resp.AccessToken, nil
 }
 
 type requestParameters struct {
@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestBackoffDelayCapsAndJitters(t *testing.T) {
+	c := &Client{retryBaseDelay: 100 * time.Millisecond, retryMaxDelay: time.Second}
+
+	for attempt := 0; attempt <= 10; attempt++ {
+		got := c.backoffDelay(attempt)
+		if got < 0 {
+			t.Fatalf("backoffDelay(%d) = %v, want >= 0", attempt, got)
+		}
+		if got > c.retryMaxDelay {
+			t.Fatalf("backoffDelay(%d) = %v, want <= max delay %v", attempt, got, c.retryMaxDelay)
+		}
+	}
+
+	// At a high enough attempt count, the exponential term has long since
+	// exceeded retryMaxDelay, so the cap must dominate.
+	if got := c.backoffDelay(30); got > c.retryMaxDelay {
+		t.Fatalf("backoffDelay(30) = %v, want <= max delay %v", got, c.retryMaxDelay)
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	future := time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{"empty", "", 0},
+		{"invalid", "not-a-date-or-number", 0},
+		{"seconds", "120", 120 * time.Second},
+		{"zero_seconds", "0", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfterDelay(tt.header); got != tt.want {
+				t.Fatalf("retryAfterDelay(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+
+	got := retryAfterDelay(future)
+	if got <= time.Minute || got > 2*time.Minute {
+		t.Fatalf("retryAfterDelay(%q) = %v, want roughly 2m", future, got)
+	}
+}
+
+func TestIsRetryableStatusDefaults(t *testing.T) {
+	c := &Client{}
+
+	retryable := []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, 599}
+	for _, status := range retryable {
+		if !c.isRetryableStatus(status) {
+			t.Errorf("isRetryableStatus(%d) = false, want true", status)
+		}
+	}
+
+	notRetryable := []int{http.StatusOK, http.StatusBadRequest, http.StatusNotFound, http.StatusUnauthorized}
+	for _, status := range notRetryable {
+		if c.isRetryableStatus(status) {
+			t.Errorf("isRetryableStatus(%d) = true, want false", status)
+		}
+	}
+}
+
+func TestIsRetryableStatusExplicitList(t *testing.T) {
+	c := &Client{retryOnStatuses: toStatusSet([]int{429})}
+
+	if !c.isRetryableStatus(http.StatusTooManyRequests) {
+		t.Fatal("isRetryableStatus(429) = false, want true")
+	}
+	// With an explicit list configured, statuses that would otherwise be
+	// transient (e.g. 500) are no longer retried unless listed.
+	if c.isRetryableStatus(http.StatusInternalServerError) {
+		t.Fatal("isRetryableStatus(500) = true, want false")
+	}
+}
+
+func TestAfterResponseAIMD(t *testing.T) {
+	c := &Client{baseRate: 10, limiter: rate.NewLimiter(rate.Limit(10), 1)}
+
+	c.afterResponse(http.StatusTooManyRequests)
+	if got := float64(c.limiter.Limit()); got != 5 {
+		t.Fatalf("limit after 429 = %v, want 5", got)
+	}
+
+	c.afterResponse(http.StatusTooManyRequests)
+	if got := float64(c.limiter.Limit()); got != 2.5 {
+		t.Fatalf("limit after second 429 = %v, want 2.5", got)
+	}
+
+	c.afterResponse(http.StatusOK)
+	if got := float64(c.limiter.Limit()); got <= 2.5 || got >= 10 {
+		t.Fatalf("limit after recovery step = %v, want strictly between 2.5 and 10", got)
+	}
+
+	// Repeated non-429 responses must recover back to, but never above,
+	// baseRate.
+	for i := 0; i < 1000; i++ {
+		c.afterResponse(http.StatusOK)
+	}
+	if got := float64(c.limiter.Limit()); got != c.baseRate {
+		t.Fatalf("limit after full recovery = %v, want %v", got, c.baseRate)
+	}
+}
@@ -0,0 +1,371 @@
+package batch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec reads decoded input rows and writes encoded results, abstracting
+// over the on-disk representation (NDJSON, a streamed JSON array, CSV, ...)
+// so RunWithCodec does not need to know the format of the files it reads
+// from or writes to.
+type Codec interface {
+	// Decode reads the next row of input into v. It returns io.EOF once the
+	// input is exhausted.
+	Decode(v *map[string]any) error
+	// Encode writes a single result.
+	Encode(r result) error
+	// Close flushes any buffered output and closes the underlying file, if
+	// any.
+	Close() error
+}
+
+// JSONLinesCodec implements Codec for newline-delimited JSON, the tool's
+// original input/output format.
+type JSONLinesCodec struct {
+	decoder *json.Decoder
+	encoder *json.Encoder
+	close   func() error
+}
+
+// NewJSONLinesInputCodec creates a JSONLinesCodec for reading NDJSON rows
+// from r. close is called, if non-nil, when the codec is closed.
+func NewJSONLinesInputCodec(r io.Reader, close func() error) *JSONLinesCodec {
+	return &JSONLinesCodec{decoder: json.NewDecoder(r), close: close}
+}
+
+// NewJSONLinesOutputCodec creates a JSONLinesCodec for writing results as
+// NDJSON to w. close is called, if non-nil, when the codec is closed.
+func NewJSONLinesOutputCodec(w io.Writer, close func() error) *JSONLinesCodec {
+	return &JSONLinesCodec{encoder: json.NewEncoder(w), close: close}
+}
+
+// Decode reads the next NDJSON row.
+func (c *JSONLinesCodec) Decode(v *map[string]any) error {
+	return c.decoder.Decode(v)
+}
+
+// Encode writes r as a single line of JSON.
+func (c *JSONLinesCodec) Encode(r result) error {
+	return c.encoder.Encode(r)
+}
+
+// Close closes the underlying file, if any.
+func (c *JSONLinesCodec) Close() error {
+	if c.close == nil {
+		return nil
+	}
+	return c.close()
+}
+
+// JSONArrayCodec implements Codec for a single top-level JSON array, e.g.
+// `[ {...}, {...} ]`, decoding and encoding its elements one at a time
+// instead of holding the whole array in memory.
+type JSONArrayCodec struct {
+	decoder *json.Decoder
+	started bool
+
+	mu         sync.Mutex
+	writer     io.Writer
+	encoder    *json.Encoder
+	wroteFirst bool
+
+	close func() error
+}
+
+// NewJSONArrayInputCodec creates a JSONArrayCodec for reading the elements
+// of a JSON array from r.
+func NewJSONArrayInputCodec(r io.Reader, close func() error) *JSONArrayCodec {
+	return &JSONArrayCodec{decoder: json.NewDecoder(r), close: close}
+}
+
+// NewJSONArrayOutputCodec creates a JSONArrayCodec for streaming results as
+// a JSON array to w, writing the opening bracket immediately.
+func NewJSONArrayOutputCodec(w io.Writer, close func() error) (*JSONArrayCodec, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+	return &JSONArrayCodec{writer: w, encoder: json.NewEncoder(w), close: close}, nil
+}
+
+// Decode reads the next element of the array, returning io.EOF once the
+// closing bracket has been consumed.
+func (c *JSONArrayCodec) Decode(v *map[string]any) error {
+	if !c.started {
+		token, err := c.decoder.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return fmt.Errorf("expected input to start with a JSON array, got %v", token)
+		}
+		c.started = true
+	}
+	if !c.decoder.More() {
+		_, _ = c.decoder.Token() // consume the closing ']'
+		return io.EOF
+	}
+	return c.decoder.Decode(v)
+}
+
+// Encode writes r as the next element of the array, comma-separating it
+// from any previous element.
+func (c *JSONArrayCodec) Encode(r result) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wroteFirst {
+		if _, err := io.WriteString(c.writer, ","); err != nil {
+			return err
+		}
+	}
+	c.wroteFirst = true
+	return c.encoder.Encode(r)
+}
+
+// Close writes the closing bracket and closes the underlying file, if any.
+func (c *JSONArrayCodec) Close() error {
+	if c.writer != nil {
+		if _, err := io.WriteString(c.writer, "]\n"); err != nil {
+			return err
+		}
+	}
+	if c.close == nil {
+		return nil
+	}
+	return c.close()
+}
+
+// CSVCodec implements Codec for CSV files: on input, the header row names
+// the variables and every following row becomes a map[string]any with
+// string values; on output, result.Output is flattened into columns using a
+// list of JSONPath-ish selectors (e.g. "a.b" or "c[0].d"), followed by
+// "error" and "skipped" columns.
+type CSVCodec struct {
+	reader *csv.Reader
+	header []string
+
+	mu            sync.Mutex
+	writer        *csv.Writer
+	outputFields  []string
+	fieldsKnown   bool
+	headerWritten bool
+	rawFallback   bool
+	pendingRows   []result
+	close         func() error
+}
+
+// NewCSVInputCodec creates a CSVCodec for reading variables from r. The
+// first row is read immediately to establish the variable names.
+func NewCSVInputCodec(r io.Reader, close func() error) (*CSVCodec, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	return &CSVCodec{reader: reader, header: header, close: close}, nil
+}
+
+// NewCSVOutputCodec creates a CSVCodec for writing results to w. If
+// outputFields is empty, the header is buffered until the first successful
+// result determines the available columns.
+func NewCSVOutputCodec(w io.Writer, outputFields []string, close func() error) *CSVCodec {
+	c := &CSVCodec{writer: csv.NewWriter(w), outputFields: outputFields, close: close}
+	if len(outputFields) > 0 {
+		c.fieldsKnown = true
+	}
+	return c
+}
+
+// Decode reads the next CSV row into a map keyed by the header names.
+func (c *CSVCodec) Decode(v *map[string]any) error {
+	record, err := c.reader.Read()
+	if err != nil {
+		return err
+	}
+	m := make(map[string]any, len(c.header))
+	for i, name := range c.header {
+		if i < len(record) {
+			m[name] = record[i]
+		}
+	}
+	*v = m
+	return nil
+}
+
+// Encode writes r as a CSV row, buffering it until the output columns are
+// known if they were not configured explicitly.
+func (c *CSVCodec) Encode(r result) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.fieldsKnown {
+		m, ok := r.Output.(map[string]any)
+		if r.Error != nil || !ok {
+			c.pendingRows = append(c.pendingRows, r)
+			return nil
+		}
+		c.outputFields = sortedKeys(m)
+		c.fieldsKnown = true
+		if err := c.flushPendingLocked(); err != nil {
+			return err
+		}
+	}
+	return c.writeRowLocked(r)
+}
+
+// flushPendingLocked writes out any rows buffered while the output columns
+// were still unknown. c.mu must be held.
+func (c *CSVCodec) flushPendingLocked() error {
+	pending := c.pendingRows
+	c.pendingRows = nil
+	for _, p := range pending {
+		if err := c.writeRowLocked(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CSVCodec) writeRowLocked(r result) error {
+	if !c.headerWritten {
+		header := append([]string{"row"}, c.outputFields...)
+		header = append(header, "error", "skipped")
+		if err := c.writer.Write(header); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	row := make([]string, 0, len(c.outputFields)+3)
+	row = append(row, strconv.Itoa(r.Row))
+	if c.rawFallback {
+		row = append(row, formatCSVValue(r.Output))
+	} else {
+		for _, field := range c.outputFields {
+			row = append(row, formatCSVValue(selectField(r.Output, field)))
+		}
+	}
+	errMsg := ""
+	if r.Error != nil {
+		errMsg = *r.Error
+	}
+	row = append(row, errMsg, strconv.FormatBool(r.Skipped))
+
+	if err := c.writer.Write(row); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// Close flushes any rows that never determined their output columns (using
+// a single raw "output" column as a last resort) and closes the underlying
+// file, if any.
+func (c *CSVCodec) Close() error {
+	c.mu.Lock()
+	if !c.fieldsKnown && len(c.pendingRows) > 0 {
+		c.outputFields = []string{"output"}
+		c.rawFallback = true
+		c.fieldsKnown = true
+		if err := c.flushPendingLocked(); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	if c.writer != nil {
+		c.writer.Flush()
+		if err := c.writer.Error(); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	c.mu.Unlock()
+
+	if c.close == nil {
+		return nil
+	}
+	return c.close()
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// selectField resolves a simple JSONPath-ish selector (dot-separated field
+// names with optional [index] subscripts, e.g. "a.b" or "c[0].d") against a
+// decoded JSON value, returning nil if any segment does not resolve.
+func selectField(v any, path string) any {
+	cur := v
+	for _, segment := range strings.Split(path, ".") {
+		name, indices := parseSelectorSegment(segment)
+		if name != "" {
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return nil
+			}
+			cur = m[name]
+		}
+		for _, idx := range indices {
+			s, ok := cur.([]any)
+			if !ok || idx < 0 || idx >= len(s) {
+				return nil
+			}
+			cur = s[idx]
+		}
+	}
+	return cur
+}
+
+// parseSelectorSegment splits a selector segment like "c[0][1]" into its
+// field name ("c") and subscripts ([0, 1]).
+func parseSelectorSegment(segment string) (string, []int) {
+	name := segment
+	var indices []int
+	for {
+		start := strings.IndexByte(name, '[')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(name[start:], ']')
+		if end == -1 {
+			break
+		}
+		end += start
+		if idx, err := strconv.Atoi(name[start+1 : end]); err == nil {
+			indices = append(indices, idx)
+		}
+		name = name[:start] + name[end+1:]
+	}
+	return name, indices
+}
+
+// formatCSVValue renders a decoded JSON value as a single CSV cell.
+func formatCSVValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprintf("%v", t)
+		}
+		return string(b)
+	}
+}
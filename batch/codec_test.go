@@ -0,0 +1,148 @@
+package batch
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestJSONLinesCodecRoundTrip(t *testing.T) {
+	in := strings.NewReader("{\"a\":1}\n{\"a\":2}\n")
+	input := NewJSONLinesInputCodec(in, nil)
+
+	var rows []map[string]any
+	for {
+		v := map[string]any{}
+		err := input.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		rows = append(rows, v)
+	}
+	if len(rows) != 2 || rows[0]["a"] != float64(1) || rows[1]["a"] != float64(2) {
+		t.Fatalf("decoded rows = %v, want [{a:1} {a:2}]", rows)
+	}
+
+	var buf bytes.Buffer
+	output := NewJSONLinesOutputCodec(&buf, nil)
+	if err := output.Encode(result{Row: 1, Output: map[string]any{"a": 1}}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := output.Encode(result{Row: 2, Error: errMsgPtr("boom")}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	got := buf.String()
+	if !strings.Contains(got, `"row":1`) || !strings.Contains(got, `"row":2`) || !strings.Contains(got, `"boom"`) {
+		t.Fatalf("encoded output = %q, missing expected rows", got)
+	}
+}
+
+func TestJSONArrayCodecRoundTrip(t *testing.T) {
+	in := strings.NewReader(`[{"a":1},{"a":2}]`)
+	input := NewJSONArrayInputCodec(in, nil)
+
+	var rows []map[string]any
+	for {
+		v := map[string]any{}
+		err := input.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		rows = append(rows, v)
+	}
+	if len(rows) != 2 || rows[0]["a"] != float64(1) || rows[1]["a"] != float64(2) {
+		t.Fatalf("decoded rows = %v, want [{a:1} {a:2}]", rows)
+	}
+
+	var buf bytes.Buffer
+	output, err := NewJSONArrayOutputCodec(&buf, nil)
+	if err != nil {
+		t.Fatalf("NewJSONArrayOutputCodec: %v", err)
+	}
+	if err := output.Encode(result{Row: 1, Output: map[string]any{"a": 1}}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := output.Encode(result{Row: 2, Output: map[string]any{"a": 2}}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := output.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := "[{\"row\":1,\"input\":null,\"output\":{\"a\":1},\"error\":null}\n,{\"row\":2,\"input\":null,\"output\":{\"a\":2},\"error\":null}\n]\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("encoded array = %q, want %q", got, want)
+	}
+}
+
+func TestJSONArrayCodecRejectsNonArrayInput(t *testing.T) {
+	input := NewJSONArrayInputCodec(strings.NewReader(`{"a":1}`), nil)
+	v := map[string]any{}
+	if err := input.Decode(&v); err == nil {
+		t.Fatal("Decode of a non-array input = nil error, want an error")
+	}
+}
+
+func TestCSVCodecRoundTrip(t *testing.T) {
+	in := strings.NewReader("a,b\n1,2\n3,4\n")
+	input, err := NewCSVInputCodec(in, nil)
+	if err != nil {
+		t.Fatalf("NewCSVInputCodec: %v", err)
+	}
+
+	v := map[string]any{}
+	if err := input.Decode(&v); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if v["a"] != "1" || v["b"] != "2" {
+		t.Fatalf("decoded row = %v, want {a:1 b:2}", v)
+	}
+
+	var buf bytes.Buffer
+	output := NewCSVOutputCodec(&buf, nil, nil)
+	if err := output.Encode(result{Row: 1, Output: map[string]any{"x": "y"}}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := output.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := "row,x,error,skipped\n1,y,,false\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("encoded CSV = %q, want %q", got, want)
+	}
+}
+
+func TestCSVCodecBuffersUntilFieldsKnownThenFallsBack(t *testing.T) {
+	var buf bytes.Buffer
+	output := NewCSVOutputCodec(&buf, nil, nil)
+
+	// Every row is an error (no map Output), so the field-known columns are
+	// never established and Close must fall back to a single raw column
+	// instead of leaving the file empty.
+	if err := output.Encode(result{Row: 1, Error: errMsgPtr("boom")}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := output.Encode(result{Row: 2, Skipped: true}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := output.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := "row,output,error,skipped\n1,,boom,false\n2,,,true\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("encoded CSV = %q, want %q", got, want)
+	}
+}
+
+func errMsgPtr(msg string) *string {
+	return &msg
+}
@@ -1,5 +1,7 @@
 package batch
 
+import "time"
+
 // Config holds the run configuration.
 type Config struct {
 	URL         string
@@ -12,6 +14,87 @@ type Config struct {
 	InputFile   string
 	OutputFile  string
 	ErrorFile   string
+
+	// UnixSocket, if set, dials this Unix domain socket instead of making a
+	// TCP connection to reach the GraphQL endpoint. URL is still used as
+	// the request target (and its scheme, http or https, selects whether
+	// the connection is upgraded to TLS on top of the socket); only its
+	// host is otherwise ignored, so a placeholder such as "http://unix/graphql"
+	// is conventional.
+	UnixSocket string
+	// TLSServerName overrides the server name used to validate the
+	// certificate when connecting to UnixSocket with an https:// URL
+	// (TLS over UDS). Defaults to URL's host if empty.
+	TLSServerName string
+
+	// InputFormat and OutputFormat select the Codec used for the input and
+	// output files: "jsonl", "json" or "csv". Empty autodetects from the
+	// file's extension, falling back to "jsonl".
+	InputFormat  string
+	OutputFormat string
+	// OutputFields flattens the CSVCodec output using a list of
+	// JSONPath-ish selectors (e.g. "a.b,c[0].d") applied to result.Output.
+	// Ignored for other output formats. If empty, the columns are taken
+	// from the first successful result's top-level keys.
+	OutputFields []string
+
+	// RetryMaxAttempts is the maximum number of additional attempts made for
+	// a request that fails with a transient error. Zero uses
+	// DefaultRetryMaxAttempts.
+	RetryMaxAttempts int
+	// RetryBaseDelay is the base delay used for the capped exponential
+	// backoff with full jitter between retries. Zero uses
+	// DefaultRetryBaseDelay.
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay caps the backoff delay between retries. Zero uses
+	// DefaultRetryMaxDelay.
+	RetryMaxDelay time.Duration
+	// RetryOnStatuses restricts retries to the given HTTP status codes. If
+	// empty, 408, 429 and any 5xx status are retried.
+	RetryOnStatuses []int
+
+	// RequestsPerSecond enables a token-bucket rate limiter applied before
+	// every attempt. Zero or negative disables rate limiting.
+	RequestsPerSecond float64
+	// Burst is the rate limiter's burst size. Values <= 0 are treated as 1.
+	Burst int
+
+	// MetricsAddr, if set, starts an HTTP server on this address exposing
+	// Prometheus metrics on /metrics for the duration of the run.
+	MetricsAddr string
+
+	// LogFormat selects the Logger implementation used for operational
+	// logs written to stderr: "text" (default) or "json".
+	LogFormat string
+	// LogLevel is the minimum severity emitted by the Logger: "debug",
+	// "info" (default), "warn" or "error".
+	LogLevel string
+
+	// CheckpointFile, if set, records the highest contiguously completed
+	// input row as the run progresses, so an interrupted run can be
+	// resumed with Resume or ResumeFrom.
+	CheckpointFile string
+	// CheckpointEveryRows and CheckpointInterval control how often
+	// CheckpointFile is flushed to disk: every N newly completed rows or
+	// every duration, whichever comes first. Zero uses
+	// DefaultCheckpointEveryRows/DefaultCheckpointInterval.
+	CheckpointEveryRows int
+	CheckpointInterval  time.Duration
+	// Resume skips input rows up to the watermark recorded in
+	// CheckpointFile before processing starts. Requires CheckpointFile.
+	Resume bool
+	// ResumeFrom unconditionally skips this many input rows before
+	// processing starts, taking precedence over Resume.
+	ResumeFrom int
+
+	// DedupeKey, if set, is a JSONPath-ish selector (see CSVCodec) applied
+	// to each row's input variables; a persistent set of already-seen keys
+	// is kept in DedupeFile so that re-running with overlapping input rows
+	// does not repeat their side effects.
+	DedupeKey string
+	// DedupeFile is where the DedupeKey set is persisted. If empty and
+	// DedupeKey is set, it defaults to CheckpointFile + ".dedupe".
+	DedupeFile string
 }
 
 // OAuthConfig holds the credentials for the OAuth 2.0 client credentials flow.
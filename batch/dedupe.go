@@ -0,0 +1,118 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DedupeSet is a persistent, file-backed set of dedupe keys already
+// processed by this or a prior run, used so that re-running a job against
+// an input with overlapping rows does not repeat their side effects.
+//
+// DedupeSet is thread-safe.
+type DedupeSet struct {
+	mu        sync.Mutex
+	seen      map[string]bool // claimed by Claim, or previously persisted
+	persisted map[string]bool // actually written to file
+	file      *os.File
+}
+
+// NewDedupeSet loads the keys already recorded at path, if any, and opens
+// it for appending any further keys Add records.
+func NewDedupeSet(path string) (*DedupeSet, error) {
+	seen := map[string]bool{}
+	existing, err := os.Open(filepath.Clean(path))
+	if err == nil {
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				seen[line] = true
+			}
+		}
+		scanErr := scanner.Err()
+		closeErr := existing.Close()
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		if closeErr != nil {
+			return nil, closeErr
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	persisted := make(map[string]bool, len(seen))
+	for key := range seen {
+		persisted[key] = true
+	}
+
+	f, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &DedupeSet{seen: seen, persisted: persisted, file: f}, nil
+}
+
+// Seen reports whether key is already known to this DedupeSet, either
+// because a previous run persisted it or because Claim already claimed it
+// earlier in this one.
+func (d *DedupeSet) Seen(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.seen[key]
+}
+
+// Claim atomically checks Seen and, if key was not yet seen, marks it
+// claimed and reports true. Call this synchronously, before a row is
+// dispatched to a worker goroutine, so that a duplicate key appearing twice
+// in one input is suppressed even though the first occurrence's Add (which
+// only runs once its request succeeds) has not happened yet.
+func (d *DedupeSet) Claim(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen[key] {
+		return false
+	}
+	d.seen[key] = true
+	return true
+}
+
+// Add persists key to disk, unless it was already persisted by a previous
+// run or an earlier Add in this one, so an interrupted run does not lose
+// track of it.
+func (d *DedupeSet) Add(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.persisted[key] {
+		return nil
+	}
+	if _, err := d.file.WriteString(key + "\n"); err != nil {
+		return err
+	}
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+	d.persisted[key] = true
+	d.seen[key] = true
+	return nil
+}
+
+// Close closes the underlying file.
+func (d *DedupeSet) Close() error {
+	return d.file.Close()
+}
+
+// dedupeKeyFor resolves path (a JSONPath-ish selector, see selectField)
+// against variables and renders the result as a canonical dedupe key.
+func dedupeKeyFor(variables map[string]any, path string) string {
+	v := selectField(variables, path)
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
@@ -0,0 +1,58 @@
+package batch
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupeSetClaimSuppressesDuplicateWithinRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedupe")
+	d, err := NewDedupeSet(path)
+	if err != nil {
+		t.Fatalf("NewDedupeSet: %v", err)
+	}
+	defer func() { _ = d.Close() }()
+
+	// The first occurrence of a key claims it before its request completes...
+	if !d.Claim("a") {
+		t.Fatal("Claim(\"a\") = false on first occurrence, want true")
+	}
+	// ...so a second occurrence of the same key, arriving while the first
+	// is still in flight (before any Add), must be suppressed too.
+	if d.Claim("a") {
+		t.Fatal("Claim(\"a\") = true on second occurrence, want false")
+	}
+	if d.Claim("b") != true {
+		t.Fatal("Claim(\"b\") = false, want true for a distinct key")
+	}
+}
+
+func TestDedupeSetPersistsAcrossRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedupe")
+
+	first, err := NewDedupeSet(path)
+	if err != nil {
+		t.Fatalf("NewDedupeSet: %v", err)
+	}
+	if !first.Claim("a") {
+		t.Fatal("Claim(\"a\") = false, want true")
+	}
+	if err := first.Add("a"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	second, err := NewDedupeSet(path)
+	if err != nil {
+		t.Fatalf("NewDedupeSet: %v", err)
+	}
+	defer func() { _ = second.Close() }()
+	if !second.Seen("a") {
+		t.Fatal("Seen(\"a\") = false after reopening, want true")
+	}
+	if second.Claim("a") {
+		t.Fatal("Claim(\"a\") = true after reopening, want false")
+	}
+}
@@ -0,0 +1,196 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+// Log levels, ordered from most to least verbose.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the upper-case name of the level, e.g. "INFO".
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// parseLevel parses one of "debug", "info", "warn"/"warning" or "error"
+// (case-insensitive). An empty string defaults to LevelInfo.
+func parseLevel(level string) (Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", level)
+	}
+}
+
+// Logger records structured operational events. Implementations must be
+// safe for concurrent use, since Run processes requests in parallel.
+//
+// kv is a list of alternating key/value pairs, e.g.
+// logger.Info("request.done", "row", 1, "status_code", 200).
+type Logger interface {
+	Debug(msg string, kv ...any)
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+}
+
+// NewLogger creates a Logger writing to w: a TextLogger for format "text"
+// (the default if empty) or a JSONLogger for format "json". level sets the
+// minimum severity emitted and defaults to LevelInfo if empty.
+func NewLogger(format, level string, w io.Writer) (Logger, error) {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return &TextLogger{w: w, level: lvl}, nil
+	case "json":
+		return &JSONLogger{w: w, level: lvl}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// NopLogger discards every log line. It is useful for callers of
+// RunWithCodec that do not want operational logs, e.g. source-compatible
+// callers of the deprecated RunWith.
+type NopLogger struct{}
+
+// Debug is a no-op.
+func (l *NopLogger) Debug(msg string, kv ...any) {}
+
+// Info is a no-op.
+func (l *NopLogger) Info(msg string, kv ...any) {}
+
+// Warn is a no-op.
+func (l *NopLogger) Warn(msg string, kv ...any) {}
+
+// Error is a no-op.
+func (l *NopLogger) Error(msg string, kv ...any) {}
+
+// TextLogger writes human-readable log lines of the form
+// "LEVEL msg key=value key=value" to w. This is the tool's original,
+// unstructured logging behavior.
+//
+// TextLogger is thread-safe.
+type TextLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+// Debug logs msg and kv at LevelDebug.
+func (l *TextLogger) Debug(msg string, kv ...any) { l.log(LevelDebug, msg, kv) }
+
+// Info logs msg and kv at LevelInfo.
+func (l *TextLogger) Info(msg string, kv ...any) { l.log(LevelInfo, msg, kv) }
+
+// Warn logs msg and kv at LevelWarn.
+func (l *TextLogger) Warn(msg string, kv ...any) { l.log(LevelWarn, msg, kv) }
+
+// Error logs msg and kv at LevelError.
+func (l *TextLogger) Error(msg string, kv ...any) { l.log(LevelError, msg, kv) }
+
+func (l *TextLogger) log(level Level, msg string, kv []any) {
+	if level < l.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.w, b.String())
+}
+
+// JSONLogger writes one JSON object per log line to w, with "level", "ts"
+// and "msg" fields plus whatever structured fields were passed in kv, e.g.
+// "row", "status_code", "duration_ms", "attempt" or "error". This format is
+// intended for shipping logs into tools like ELK or Loki.
+//
+// JSONLogger is thread-safe.
+type JSONLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+// Debug logs msg and kv at LevelDebug.
+func (l *JSONLogger) Debug(msg string, kv ...any) { l.log(LevelDebug, msg, kv) }
+
+// Info logs msg and kv at LevelInfo.
+func (l *JSONLogger) Info(msg string, kv ...any) { l.log(LevelInfo, msg, kv) }
+
+// Warn logs msg and kv at LevelWarn.
+func (l *JSONLogger) Warn(msg string, kv ...any) { l.log(LevelWarn, msg, kv) }
+
+// Error logs msg and kv at LevelError.
+func (l *JSONLogger) Error(msg string, kv ...any) { l.log(LevelError, msg, kv) }
+
+func (l *JSONLogger) log(level Level, msg string, kv []any) {
+	if level < l.level {
+		return
+	}
+	fields := make(map[string]any, len(kv)/2+3)
+	fields["level"] = strings.ToLower(level.String())
+	fields["ts"] = time.Now().UTC().Format(time.RFC3339Nano)
+	fields["msg"] = msg
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			continue
+		}
+		if err, ok := kv[i+1].(error); ok {
+			fields[key] = err.Error()
+			continue
+		}
+		fields[key] = kv[i+1]
+	}
+	line, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line)
+}
@@ -3,54 +3,270 @@ package batch
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/sync/semaphore"
 )
 
 // Run processes the GraphQL requests using the provided configuration.
 func Run(ctx context.Context, config Config) error {
+	logger, err := NewLogger(config.LogFormat, config.LogLevel, os.Stderr)
+	if err != nil {
+		return err
+	}
+
 	query, err := readFile(config.QueryFile)
 	if err != nil {
 		return err
 	}
 
-	input, closeInput, err := openInput(config.InputFile)
+	input, err := openInputCodec(config.InputFile, config.InputFormat)
 	if err != nil {
 		return err
 	}
-	defer closeInput()
+	defer func() { _ = input.Close() }()
 
-	output, closeOutput, err := openOutput(config.OutputFile, os.Stdout)
+	output, err := openOutputCodec(config.OutputFile, config.OutputFormat, config.OutputFields, os.Stdout)
 	if err != nil {
 		return err
 	}
-	defer closeOutput()
+	defer func() { _ = output.Close() }()
 
-	errOutput, closeErrorOutput, err := openOutput(config.ErrorFile, os.Stderr)
+	// the error stream is always NDJSON, regardless of --output-format,
+	// since it is meant to be consumed by other tooling, not reimported.
+	errOutput, err := openOutputCodec(config.ErrorFile, "jsonl", nil, os.Stderr)
 	if err != nil {
 		return err
 	}
-	defer closeErrorOutput()
+	defer func() { _ = errOutput.Close() }()
 
-	client, err := NewClient(config, query)
+	stats := PrintStats(config.Verbose, 5*time.Second, logger)
+
+	if config.MetricsAddr != "" {
+		promStats := NewPrometheusStats()
+		stats = multiStats{stats, promStats}
+		defer serveMetrics(config.MetricsAddr, promStats, logger)()
+	}
+
+	client, err := NewClient(config, query, stats, logger)
 	if err != nil {
 		return err
 	}
-	stats := PrintStats(config.Verbose, 5*time.Second)
 
-	return RunWith(ctx, client, input, output, errOutput, stats, config.Connections)
+	resume, err := setupResume(config)
+	if err != nil {
+		return err
+	}
+	if resume.Checkpoint != nil {
+		defer func() { _ = resume.Checkpoint.Close() }()
+	}
+	if resume.Dedupe != nil {
+		defer func() { _ = resume.Dedupe.Close() }()
+	}
+
+	return RunWithCodec(ctx, client, input, output, errOutput, stats, logger, config.Connections, resume)
+}
+
+// setupResume resolves how many input rows to skip and opens the
+// Checkpoint/DedupeSet configured for the run, if any.
+func setupResume(config Config) (ResumeOptions, error) {
+	var resume ResumeOptions
+	resume.DedupeKey = config.DedupeKey
+
+	if config.CheckpointFile != "" {
+		checkpoint, err := NewCheckpoint(config.CheckpointFile, config.CheckpointEveryRows, config.CheckpointInterval)
+		if err != nil {
+			return ResumeOptions{}, err
+		}
+		resume.Checkpoint = checkpoint
+	}
+
+	switch {
+	case config.ResumeFrom > 0:
+		resume.SkipRows = config.ResumeFrom
+	case config.Resume:
+		if config.CheckpointFile == "" {
+			return ResumeOptions{}, fmt.Errorf("--resume requires --checkpoint")
+		}
+		skip, err := ReadCheckpoint(config.CheckpointFile)
+		if err != nil {
+			return ResumeOptions{}, err
+		}
+		resume.SkipRows = skip
+	}
+
+	// The Checkpoint just opened above knows nothing about rows skipped on
+	// this resumed run; seed its watermark so Complete's contiguous-run
+	// detection picks up where the prior run left off instead of from 0.
+	if resume.Checkpoint != nil && resume.SkipRows > 0 {
+		resume.Checkpoint.SeedWatermark(resume.SkipRows)
+	}
+
+	if config.DedupeKey != "" {
+		dedupeFile := config.DedupeFile
+		if dedupeFile == "" {
+			if config.CheckpointFile == "" {
+				return ResumeOptions{}, fmt.Errorf("--dedupe-key requires --checkpoint or --dedupe-file")
+			}
+			dedupeFile = config.CheckpointFile + ".dedupe"
+		}
+		dedupe, err := NewDedupeSet(dedupeFile)
+		if err != nil {
+			return ResumeOptions{}, err
+		}
+		resume.Dedupe = dedupe
+	}
+
+	return resume, nil
+}
+
+// detectFormat resolves the format to use for a file: explicit, if set,
+// otherwise inferred from the file's extension, falling back to NDJSON
+// (e.g. for stdin/stdout, which have no extension to go by).
+func detectFormat(explicit, file string) string {
+	if explicit != "" {
+		return explicit
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	default:
+		return "jsonl"
+	}
+}
+
+func openInputCodec(inputFile, format string) (Codec, error) {
+	var r io.Reader
+	var close func() error
+	if inputFile == "" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(filepath.Clean(inputFile))
+		if err != nil {
+			return nil, err
+		}
+		r = f
+		close = f.Close
+	}
+
+	switch detectFormat(format, inputFile) {
+	case "csv":
+		return NewCSVInputCodec(r, close)
+	case "json":
+		return NewJSONArrayInputCodec(r, close), nil
+	default:
+		return NewJSONLinesInputCodec(r, close), nil
+	}
+}
+
+func openOutputCodec(outputFile, format string, outputFields []string, defaultWriter io.Writer) (Codec, error) {
+	var w io.Writer
+	var close func() error
+	if outputFile == "" {
+		w = defaultWriter
+	} else {
+		f, err := os.Create(filepath.Clean(outputFile))
+		if err != nil {
+			return nil, err
+		}
+		w = f
+		close = f.Close
+	}
+
+	switch detectFormat(format, outputFile) {
+	case "csv":
+		return NewCSVOutputCodec(w, outputFields, close), nil
+	case "json":
+		return NewJSONArrayOutputCodec(w, close)
+	default:
+		return NewJSONLinesOutputCodec(w, close), nil
+	}
 }
 
-// RunWith processes the GraphQL requests using the configured dependencies.
+// serveMetrics starts an HTTP server exposing promStats on /metrics and
+// returns a function that shuts it down.
+func serveMetrics(addr string, promStats *PrometheusStats, logger Logger) func() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(promStats.Registry(), promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("metrics.server", "error", err)
+		}
+	}()
+
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}
+}
+
+// RunWith processes the GraphQL requests reading NDJSON input and writing
+// NDJSON output/errors.
+//
+// Deprecated: kept for source compatibility; prefer RunWithCodec, which
+// supports pluggable input/output formats via Codec.
 func RunWith(ctx context.Context, client *Client, input *json.Decoder, output *json.Encoder, errOutput *json.Encoder, stats Stats, connections int) error {
+	inputCodec := &JSONLinesCodec{decoder: input}
+	outputCodec := &JSONLinesCodec{encoder: output}
+	errOutputCodec := &JSONLinesCodec{encoder: errOutput}
+	return RunWithCodec(ctx, client, inputCodec, outputCodec, errOutputCodec, stats, &NopLogger{}, connections, ResumeOptions{})
+}
+
+// ResumeOptions configures resumable, idempotent runs: how many leading
+// input rows to skip, where to persist the completed-row watermark, and how
+// to deduplicate rows that were already processed by a prior run. The zero
+// value disables all of it.
+type ResumeOptions struct {
+	// SkipRows is the number of leading input rows to decode and discard
+	// before processing starts.
+	SkipRows int
+	// Checkpoint, if set, is advanced as rows complete and persists the
+	// watermark to disk.
+	Checkpoint *Checkpoint
+	// Dedupe, if set along with DedupeKey, is consulted to skip rows
+	// already processed and updated as rows complete successfully.
+	Dedupe    *DedupeSet
+	DedupeKey string
+}
+
+// RunWithCodec processes the GraphQL requests using the configured
+// dependencies, reading input and writing output/errors through the given
+// Codecs. Operational events are reported via logger; the response and
+// error streams themselves only ever carry the input/output data. resume
+// optionally skips already-completed rows and tracks progress for a later
+// resumed run; pass ResumeOptions{} to disable it.
+func RunWithCodec(ctx context.Context, client *Client, input, output, errOutput Codec, stats Stats, logger Logger, connections int, resume ResumeOptions) error {
 	sm := semaphore.NewWeighted(int64(connections))
 	wg := &sync.WaitGroup{}
 	row := 0
+
+	for row < resume.SkipRows {
+		row++
+		discard := map[string]any{}
+		if err := input.Decode(&discard); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+	if resume.SkipRows > 0 {
+		logger.Info("resume.skip", "rows", row)
+	}
+
 	for {
 		row++
 
@@ -63,34 +279,70 @@ func RunWith(ctx context.Context, client *Client, input *json.Decoder, output *j
 			return err
 		}
 
+		var dedupeKey string
+		if resume.DedupeKey != "" {
+			dedupeKey = dedupeKeyFor(variables, resume.DedupeKey)
+			// Claim, not Seen: this must happen synchronously here, before
+			// the row is dispatched, so a second occurrence of the same key
+			// later in the input is also suppressed even though the first
+			// occurrence's Add has not run yet (its request is still
+			// in-flight).
+			if resume.Dedupe != nil && !resume.Dedupe.Claim(dedupeKey) {
+				logger.Info("dedupe.skip", "row", row)
+				if err := writeSkipped(variables, output, row, stats); err != nil {
+					return err
+				}
+				if resume.Checkpoint != nil {
+					if err := resume.Checkpoint.Complete(row); err != nil {
+						logger.Error("checkpoint.persist_failed", "row", row, "error", err)
+					}
+				}
+				continue
+			}
+		}
+
 		err = sm.Acquire(ctx, 1)
 		if err := checkAndWriteError(err, errOutput, row, stats); err != nil {
 			return err
 		}
 
 		wg.Add(1)
-		go func(variables map[string]any, row int) {
+		go func(variables map[string]any, row int, dedupeKey string) {
 			defer wg.Done()
 			defer sm.Release(1)
-			response, err := processRequest(variables, client)
+			response, err := processRequest(ctx, variables, client, stats, logger, row)
 			if err != nil {
 				if err := writeError(err, variables, response, errOutput, row, stats); err != nil {
-					panic(err)
+					logger.Error("result.write_failed", "row", row, "error", err)
 				}
 			} else {
 				if err := writeResponse(variables, response, output, row, stats); err != nil {
-					panic(err)
+					logger.Error("result.write_failed", "row", row, "error", err)
+				}
+				if resume.Dedupe != nil && dedupeKey != "" {
+					if err := resume.Dedupe.Add(dedupeKey); err != nil {
+						logger.Error("dedupe.persist_failed", "row", row, "error", err)
+					}
 				}
 			}
-		}(variables, row)
+			if resume.Checkpoint != nil {
+				if err := resume.Checkpoint.Complete(row); err != nil {
+					logger.Error("checkpoint.persist_failed", "row", row, "error", err)
+				}
+			}
+		}(variables, row, dedupeKey)
 	}
 
 	wg.Wait()
 	return nil
 }
 
-func processRequest(variables map[string]any, client *Client) (any, error) {
-	responseBody, err := client.Do(variables)
+func processRequest(ctx context.Context, variables map[string]any, client *Client, stats Stats, logger Logger, row int) (any, error) {
+	logger.Debug("request.start", "row", row)
+	start := time.Now()
+	responseBody, statusCode, err := client.Do(ctx, variables)
+	duration := time.Since(start)
+	stats.Observe(duration, statusCode, err)
 	if responseBody != nil {
 		defer func() { _ = responseBody.Close() }()
 	}
@@ -99,14 +351,17 @@ func processRequest(variables map[string]any, client *Client) (any, error) {
 		if responseBody != nil {
 			response, _ = io.ReadAll(responseBody)
 		}
+		logger.Error("request.error", "row", row, "status_code", statusCode, "duration_ms", duration.Milliseconds(), "error", err)
 		return string(response), err
 	}
 	response := map[string]any{}
 
 	err = json.NewDecoder(responseBody).Decode(&response)
 	if err != nil {
+		logger.Error("request.error", "row", row, "status_code", statusCode, "duration_ms", duration.Milliseconds(), "error", err)
 		return nil, err
 	}
+	logger.Info("request.done", "row", row, "status_code", statusCode, "duration_ms", duration.Milliseconds())
 	return response, nil
 }
 
@@ -121,48 +376,14 @@ func readFile(name string) (string, error) {
 	return string(content), err
 }
 
-func openInput(inputFile string) (*json.Decoder, func(), error) {
-	var r io.Reader
-	var close func()
-	if inputFile == "" {
-		r = os.Stdin
-		close = func() {}
-	} else {
-		f, err := os.Open(filepath.Clean(inputFile))
-		if err != nil {
-			return nil, nil, err
-		}
-		r = f
-		close = func() { _ = f.Close() }
-	}
-	return json.NewDecoder(r), close, nil
-}
-
-func openOutput(outputFile string, defaultWriter io.Writer) (*json.Encoder, func(), error) {
-	var w io.Writer
-	var close func()
-	if outputFile == "" {
-		w = defaultWriter
-		close = func() {}
-	} else {
-		f, err := os.Create(filepath.Clean(outputFile))
-		if err != nil {
-			return nil, nil, err
-		}
-		close = func() { _ = f.Close() }
-		w = f
-	}
-	return json.NewEncoder(w), close, nil
-}
-
-func checkAndWriteError(err error, errOutput *json.Encoder, row int, stats Stats) error {
+func checkAndWriteError(err error, errOutput Codec, row int, stats Stats) error {
 	if err == nil {
 		return nil
 	}
 	return writeError(err, nil, nil, errOutput, row, stats)
 }
 
-func writeError(err error, input map[string]any, response any, errOutput *json.Encoder, row int, stats Stats) error {
+func writeError(err error, input map[string]any, response any, errOutput Codec, row int, stats Stats) error {
 	stats.AddError()
 	stats.AddProcessed()
 	errMsg := err.Error()
@@ -174,7 +395,7 @@ func writeError(err error, input map[string]any, response any, errOutput *json.E
 	})
 }
 
-func writeResponse(input map[string]any, response any, output *json.Encoder, row int, stats Stats) error {
+func writeResponse(input map[string]any, response any, output Codec, row int, stats Stats) error {
 	stats.AddProcessed()
 	return output.Encode(result{
 		Row:    row,
@@ -184,9 +405,23 @@ func writeResponse(input map[string]any, response any, output *json.Encoder, row
 	})
 }
 
+// writeSkipped records a row that DedupeSet.Claim suppressed instead of
+// dispatching, so it still counts towards the processed total and still
+// flows through the output codec instead of silently vanishing from both
+// the output and the operator-visible stats.
+func writeSkipped(input map[string]any, output Codec, row int, stats Stats) error {
+	stats.AddProcessed()
+	return output.Encode(result{
+		Row:     row,
+		Input:   input,
+		Skipped: true,
+	})
+}
+
 type result struct {
-	Row    int            `json:"row"`
-	Input  map[string]any `json:"input"`
-	Output any            `json:"output"`
-	Error  *string        `json:"error"`
+	Row     int            `json:"row"`
+	Input   map[string]any `json:"input"`
+	Output  any            `json:"output"`
+	Error   *string        `json:"error"`
+	Skipped bool           `json:"skipped,omitempty"`
 }
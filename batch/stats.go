@@ -2,23 +2,33 @@ package batch
 
 import (
 	"fmt"
+	"strconv"
 	"sync/atomic"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-// Stats can be used for counting processed and erroneous requests.
+// Stats can be used for counting processed, erroneous and retried requests.
 type Stats interface {
 	AddProcessed()
 	AddError()
-	Values() (int, int)
+	AddRetry()
+	// Observe records the outcome of a single request: its duration, the
+	// HTTP status code returned (0 if none was received) and the error, if
+	// any. Implementations that do not track timing or status codes may
+	// treat this as a no-op.
+	Observe(duration time.Duration, statusCode int, err error)
+	Values() (int, int, int)
 }
 
-// VerboseStats counts the processed and erroneous requests.
+// VerboseStats counts the processed, erroneous and retried requests.
 //
 // VerboseStats is thread-safe with regards to incrementing the counter values.
 type VerboseStats struct {
 	processed *int64
 	errors    *int64
+	retries   *int64
 }
 
 // AddProcessed increases the processed requests counter by one.
@@ -31,13 +41,24 @@ func (s *VerboseStats) AddError() {
 	atomic.AddInt64(s.errors, 1)
 }
 
-// Values returns the current counter values (processed and erroneous requests).
+// AddRetry increases the retry counter by one. It is called once per retry
+// attempt, so a request retried several times is counted several times.
+func (s *VerboseStats) AddRetry() {
+	atomic.AddInt64(s.retries, 1)
+}
+
+// Observe is a no-op; VerboseStats does not track per-request timing or
+// status codes.
+func (s *VerboseStats) Observe(duration time.Duration, statusCode int, err error) {}
+
+// Values returns the current counter values (processed, erroneous and
+// retried requests).
 //
 // Values does not lock the counters while reading them, potentially resulting
 // in situations where each counter value is correct at the time it was read,
-// but not correct when looking at both values.
-func (s *VerboseStats) Values() (int, int) {
-	return int(*s.processed), int(*s.errors)
+// but not correct when looking at all values together.
+func (s *VerboseStats) Values() (int, int, int) {
+	return int(*s.processed), int(*s.errors), int(*s.retries)
 }
 
 // SilentStats can be used when the statistics should not be collected.
@@ -49,16 +70,22 @@ func (s *SilentStats) AddProcessed() {}
 // AddError is a no-op.
 func (s *SilentStats) AddError() {}
 
+// AddRetry is a no-op.
+func (s *SilentStats) AddRetry() {}
+
+// Observe is a no-op.
+func (s *SilentStats) Observe(duration time.Duration, statusCode int, err error) {}
+
 // Values always returns zero for the counter values.
-func (s *SilentStats) Values() (int, int) {
-	return 0, 0
+func (s *SilentStats) Values() (int, int, int) {
+	return 0, 0, 0
 }
 
 // PrintStats creates an instance of Stats and if verbose is true starts
-// printing these stats to stdout regularly.
+// logging these stats via logger regularly.
 //
 // Currently there is no way to stop printing the stats.
-func PrintStats(verbose bool, d time.Duration) Stats {
+func PrintStats(verbose bool, d time.Duration, logger Logger) Stats {
 	if !verbose {
 		return &SilentStats{}
 	}
@@ -66,16 +93,148 @@ func PrintStats(verbose bool, d time.Duration) Stats {
 	s := &VerboseStats{
 		processed: new(int64),
 		errors:    new(int64),
+		retries:   new(int64),
 	}
 	start := time.Now()
 	go func() {
 		for {
 			time.Sleep(d)
-			processed, errors := s.Values()
+			processed, errors, retries := s.Values()
 			seconds := time.Since(start).Seconds()
 			processedPerSecond := float64(processed) / seconds
-			fmt.Printf("processed: %v (%.1f/s), errors: %v\n", processed, processedPerSecond, errors)
+			retryRate := 0.0
+			if processed > 0 {
+				retryRate = float64(retries) / float64(processed) * 100
+			}
+			logger.Info("stats",
+				"processed", processed,
+				"processed_per_sec", fmt.Sprintf("%.1f", processedPerSecond),
+				"errors", errors,
+				"retries", retries,
+				"retry_rate_pct", fmt.Sprintf("%.1f", retryRate),
+			)
 		}
 	}()
 	return s
 }
+
+// multiStats fans out every call to a set of Stats implementations, e.g. to
+// combine the verbose stats printer with a PrometheusStats exporter.
+type multiStats []Stats
+
+// AddProcessed calls AddProcessed on every underlying Stats.
+func (m multiStats) AddProcessed() {
+	for _, s := range m {
+		s.AddProcessed()
+	}
+}
+
+// AddError calls AddError on every underlying Stats.
+func (m multiStats) AddError() {
+	for _, s := range m {
+		s.AddError()
+	}
+}
+
+// AddRetry calls AddRetry on every underlying Stats.
+func (m multiStats) AddRetry() {
+	for _, s := range m {
+		s.AddRetry()
+	}
+}
+
+// Observe calls Observe on every underlying Stats.
+func (m multiStats) Observe(duration time.Duration, statusCode int, err error) {
+	for _, s := range m {
+		s.Observe(duration, statusCode, err)
+	}
+}
+
+// Values returns the values of the first underlying Stats that reports any
+// non-zero counter.
+func (m multiStats) Values() (int, int, int) {
+	for _, s := range m {
+		if processed, errors, retries := s.Values(); processed != 0 || errors != 0 || retries != 0 {
+			return processed, errors, retries
+		}
+	}
+	return 0, 0, 0
+}
+
+// PrometheusStats is a Stats implementation that records processed, error
+// and retry counts, response status codes and request durations as
+// Prometheus metrics, so long-running jobs can be scraped by monitoring.
+//
+// PrometheusStats is thread-safe.
+type PrometheusStats struct {
+	registry        *prometheus.Registry
+	requestsTotal   *prometheus.CounterVec
+	requestDuration prometheus.Histogram
+	statusCodes     *prometheus.CounterVec
+	retries         prometheus.Counter
+}
+
+// NewPrometheusStats creates a PrometheusStats with its own registry so it
+// can be scraped independently of the default global registry.
+func NewPrometheusStats() *PrometheusStats {
+	s := &PrometheusStats{
+		registry: prometheus.NewRegistry(),
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "batch_graphql_requests_total",
+			Help: "Total number of processed requests.",
+		}, []string{"status"}),
+		requestDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "batch_graphql_request_duration_seconds",
+			Help:    "Duration of GraphQL requests in seconds.",
+			Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}),
+		statusCodes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "batch_graphql_response_status_codes_total",
+			Help: "Total number of responses by HTTP status code.",
+		}, []string{"code"}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "batch_graphql_retries_total",
+			Help: "Total number of retry attempts.",
+		}),
+	}
+	s.registry.MustRegister(s.requestsTotal, s.requestDuration, s.statusCodes, s.retries)
+	return s
+}
+
+// Registry returns the registry the metrics are registered on, for serving
+// via promhttp.
+func (s *PrometheusStats) Registry() *prometheus.Registry {
+	return s.registry
+}
+
+// AddProcessed is a no-op; the requestsTotal counter is driven by Observe,
+// which also knows the outcome of the request.
+func (s *PrometheusStats) AddProcessed() {}
+
+// AddError is a no-op; the requestsTotal counter is driven by Observe,
+// which also knows the outcome of the request.
+func (s *PrometheusStats) AddError() {}
+
+// AddRetry increases the retries counter by one.
+func (s *PrometheusStats) AddRetry() {
+	s.retries.Inc()
+}
+
+// Observe records the request duration and status code, and increments
+// requestsTotal labelled "ok" or "error" depending on err.
+func (s *PrometheusStats) Observe(duration time.Duration, statusCode int, err error) {
+	s.requestDuration.Observe(duration.Seconds())
+	if statusCode != 0 {
+		s.statusCodes.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+	}
+	if err != nil {
+		s.requestsTotal.WithLabelValues("error").Inc()
+		return
+	}
+	s.requestsTotal.WithLabelValues("ok").Inc()
+}
+
+// Values always returns zero; use the /metrics endpoint to read counters.
+func (s *PrometheusStats) Values() (int, int, int) {
+	return 0, 0, 0
+}
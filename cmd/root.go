@@ -47,6 +47,12 @@ func init() {
 	rootCmd.Flags().IntVarP(&config.Connections, "connections", "c", 10, "number of maximum of open connections and parallel requests")
 	_ = viper.BindPFlag("connections", rootCmd.Flags().Lookup("connections"))
 
+	rootCmd.Flags().StringVar(&config.UnixSocket, "unix-socket", "", "dial this Unix domain socket instead of TCP to reach the GraphQL service named by --url (its scheme still selects plain HTTP vs TLS)")
+	_ = viper.BindPFlag("unix-socket", rootCmd.Flags().Lookup("unix-socket"))
+
+	rootCmd.Flags().StringVar(&config.TLSServerName, "tls-server-name", "", "server name for certificate validation when using --unix-socket with an https:// --url (default: --url's host)")
+	_ = viper.BindPFlag("tls-server-name", rootCmd.Flags().Lookup("tls-server-name"))
+
 	rootCmd.Flags().BoolVarP(&config.Verbose, "verbose", "v", false, "verbose output")
 	_ = viper.BindPFlag("verbose", rootCmd.Flags().Lookup("verbose"))
 
@@ -83,6 +89,63 @@ func init() {
 
 	rootCmd.Flags().StringVarP(&config.ErrorFile, "error", "e", "", "output file into which to write error responses (default stderr)")
 	_ = viper.BindPFlag("error", rootCmd.Flags().Lookup("error"))
+
+	rootCmd.Flags().IntVar(&config.RetryMaxAttempts, "retry-max-attempts", batch.DefaultRetryMaxAttempts, "maximum number of retry attempts for transient failures")
+	_ = viper.BindPFlag("retry-max-attempts", rootCmd.Flags().Lookup("retry-max-attempts"))
+
+	rootCmd.Flags().DurationVar(&config.RetryBaseDelay, "retry-base-delay", batch.DefaultRetryBaseDelay, "base delay for the capped exponential backoff between retries")
+	_ = viper.BindPFlag("retry-base-delay", rootCmd.Flags().Lookup("retry-base-delay"))
+
+	rootCmd.Flags().DurationVar(&config.RetryMaxDelay, "retry-max-delay", batch.DefaultRetryMaxDelay, "maximum delay between retries")
+	_ = viper.BindPFlag("retry-max-delay", rootCmd.Flags().Lookup("retry-max-delay"))
+
+	rootCmd.Flags().IntSliceVar(&config.RetryOnStatuses, "retry-on-status", []int{}, "HTTP status codes that should be retried (default: 408, 429 and any 5xx)")
+	_ = viper.BindPFlag("retry-on-status", rootCmd.Flags().Lookup("retry-on-status"))
+
+	rootCmd.Flags().Float64Var(&config.RequestsPerSecond, "requests-per-second", 0, "maximum number of requests per second (0 disables rate limiting)")
+	_ = viper.BindPFlag("requests-per-second", rootCmd.Flags().Lookup("requests-per-second"))
+
+	rootCmd.Flags().IntVar(&config.Burst, "burst", 1, "maximum burst size for the rate limiter")
+	_ = viper.BindPFlag("burst", rootCmd.Flags().Lookup("burst"))
+
+	rootCmd.Flags().StringVar(&config.MetricsAddr, "metrics-addr", "", "address to serve Prometheus metrics on, e.g. :9090 (disabled if empty)")
+	_ = viper.BindPFlag("metrics-addr", rootCmd.Flags().Lookup("metrics-addr"))
+
+	rootCmd.Flags().StringVar(&config.InputFormat, "input-format", "", "format of the input file: jsonl, json or csv (default: autodetect from extension, falling back to jsonl)")
+	_ = viper.BindPFlag("input-format", rootCmd.Flags().Lookup("input-format"))
+
+	rootCmd.Flags().StringVar(&config.OutputFormat, "output-format", "", "format of the output file: jsonl, json or csv (default: autodetect from extension, falling back to jsonl)")
+	_ = viper.BindPFlag("output-format", rootCmd.Flags().Lookup("output-format"))
+
+	rootCmd.Flags().StringSliceVar(&config.OutputFields, "output-fields", []string{}, "comma-separated JSONPath-ish selectors (e.g. a.b,c[0].d) flattening the output into CSV columns; if empty, columns are taken from the first successful result")
+	_ = viper.BindPFlag("output-fields", rootCmd.Flags().Lookup("output-fields"))
+
+	rootCmd.Flags().StringVar(&config.LogFormat, "log-format", "text", "format for operational logs written to stderr: text or json")
+	_ = viper.BindPFlag("log-format", rootCmd.Flags().Lookup("log-format"))
+
+	rootCmd.Flags().StringVar(&config.LogLevel, "log-level", "info", "minimum level of operational logs to emit: debug, info, warn or error")
+	_ = viper.BindPFlag("log-level", rootCmd.Flags().Lookup("log-level"))
+
+	rootCmd.Flags().StringVar(&config.CheckpointFile, "checkpoint", "", "file recording the highest contiguously completed row, for resuming interrupted runs")
+	_ = viper.BindPFlag("checkpoint", rootCmd.Flags().Lookup("checkpoint"))
+
+	rootCmd.Flags().IntVar(&config.CheckpointEveryRows, "checkpoint-every-rows", batch.DefaultCheckpointEveryRows, "flush the checkpoint file after this many newly completed rows")
+	_ = viper.BindPFlag("checkpoint-every-rows", rootCmd.Flags().Lookup("checkpoint-every-rows"))
+
+	rootCmd.Flags().DurationVar(&config.CheckpointInterval, "checkpoint-interval", batch.DefaultCheckpointInterval, "flush the checkpoint file at least this often while rows are completing")
+	_ = viper.BindPFlag("checkpoint-interval", rootCmd.Flags().Lookup("checkpoint-interval"))
+
+	rootCmd.Flags().BoolVar(&config.Resume, "resume", false, "skip input rows already recorded as completed in --checkpoint")
+	_ = viper.BindPFlag("resume", rootCmd.Flags().Lookup("resume"))
+
+	rootCmd.Flags().IntVar(&config.ResumeFrom, "resume-from", 0, "unconditionally skip this many input rows before processing (overrides --resume)")
+	_ = viper.BindPFlag("resume-from", rootCmd.Flags().Lookup("resume-from"))
+
+	rootCmd.Flags().StringVar(&config.DedupeKey, "dedupe-key", "", "JSONPath-ish selector (e.g. a.b, c[0].d) into each row's variables, used to skip rows already processed in a prior run (requires --checkpoint or --dedupe-file)")
+	_ = viper.BindPFlag("dedupe-key", rootCmd.Flags().Lookup("dedupe-key"))
+
+	rootCmd.Flags().StringVar(&config.DedupeFile, "dedupe-file", "", "file persisting the --dedupe-key set (default: <checkpoint file>.dedupe)")
+	_ = viper.BindPFlag("dedupe-file", rootCmd.Flags().Lookup("dedupe-file"))
 }
 
 // initConfig reads in config file and ENV variables if set.